@@ -0,0 +1,158 @@
+package session
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestNewAuthCodeURLDefaultsBaseApiUrl(t *testing.T) {
+	authURL, verifier, err := NewAuthCodeURL(&Config{
+		ClientId:    "clientid",
+		RedirectURI: "https://cli.example.com/callback",
+	}, "state-123")
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if verifier == "" {
+		t.Fatal("expected a non-empty code verifier")
+	}
+
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("parse authURL failed: %v", err)
+	}
+
+	want := BASE_API_URL + "/authorize"
+	got := u.Scheme + "://" + u.Host + u.Path
+	if got != want {
+		t.Errorf("expected authorize endpoint %q, got %q (full URL: %s)", want, got, authURL)
+	}
+
+	q := u.Query()
+	if q.Get("client_id") != "clientid" {
+		t.Errorf("expected client_id=clientid, got %q", q.Get("client_id"))
+	}
+
+	if q.Get("code_challenge_method") != "S256" {
+		t.Errorf("expected code_challenge_method=S256, got %q", q.Get("code_challenge_method"))
+	}
+
+	if q.Get("code_challenge") != codeChallengeS256(verifier) {
+		t.Error("code_challenge does not match S256(verifier)")
+	}
+
+	if q.Get("state") != "state-123" {
+		t.Errorf("expected state=state-123, got %q", q.Get("state"))
+	}
+}
+
+func TestNewAuthCodeURLHonorsAuthorizationEndpoint(t *testing.T) {
+	authURL, _, err := NewAuthCodeURL(&Config{
+		ClientId:              "clientid",
+		AuthorizationEndpoint: "https://login.example.com/oauth/authorize",
+	}, "state")
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("parse authURL failed: %v", err)
+	}
+
+	if u.Scheme+"://"+u.Host+u.Path != "https://login.example.com/oauth/authorize" {
+		t.Errorf("expected custom authorization endpoint to be honored, got %s", authURL)
+	}
+}
+
+func TestExchangeCode(t *testing.T) {
+	var gotBody url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		gotBody = r.PostForm
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"tok-abc","refresh_token":"rt-abc"}`))
+	}))
+	defer srv.Close()
+
+	s, err := ExchangeCode(&Config{
+		ClientId:     "clientid",
+		ClientSecret: "clientsecret",
+		RedirectURI:  "https://cli.example.com/callback",
+		BaseApiUrl:   srv.URL,
+		ApiVersion:   -1,
+		UseForm:      true,
+	}, "auth-code", "the-verifier")
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if s.AccessToken != "tok-abc" {
+		t.Errorf("expected access token tok-abc, got %q", s.AccessToken)
+	}
+
+	if s.RefreshToken != "rt-abc" {
+		t.Errorf("expected refresh token rt-abc, got %q", s.RefreshToken)
+	}
+
+	if gotBody.Get("grant_type") != "authorization_code" {
+		t.Errorf("expected grant_type=authorization_code, got %q", gotBody.Get("grant_type"))
+	}
+
+	if gotBody.Get("code") != "auth-code" {
+		t.Errorf("expected code=auth-code, got %q", gotBody.Get("code"))
+	}
+
+	if gotBody.Get("code_verifier") != "the-verifier" {
+		t.Errorf("expected code_verifier=the-verifier, got %q", gotBody.Get("code_verifier"))
+	}
+}
+
+func TestExchangeCodeDefaultsApiVersion(t *testing.T) {
+	var gotPath string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"tok-abc"}`))
+	}))
+	defer srv.Close()
+
+	// Deliberately omit ApiVersion, as a caller building a Config directly
+	// for this flow (bypassing New()) would.
+	_, err := ExchangeCode(&Config{
+		ClientId:    "clientid",
+		RedirectURI: "https://cli.example.com/callback",
+		BaseApiUrl:  srv.URL,
+		UseForm:     true,
+	}, "auth-code", "the-verifier")
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if gotPath != "/v3/access_token" {
+		t.Errorf("expected ExchangeCode to default ApiVersion to 3, got path %q", gotPath)
+	}
+}
+
+func TestGenerateCodeVerifierLength(t *testing.T) {
+	v, err := generateCodeVerifier()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(v) != 43 {
+		t.Errorf("expected a 43-octet code verifier, got %d: %s", len(v), v)
+	}
+
+	if _, err := base64.RawURLEncoding.DecodeString(v); err != nil {
+		t.Errorf("expected verifier to be valid base64url: %v", err)
+	}
+}
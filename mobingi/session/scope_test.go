@@ -0,0 +1,147 @@
+package session
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestApplyTokenResponsePreservesScopesWhenOmitted(t *testing.T) {
+	s := &Session{}
+	if _, err := s.applyTokenResponse(map[string]interface{}{
+		"access_token": "tok-1",
+		"scope":        "read write",
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(s.Scopes) != 2 || s.Scopes[0] != "read" || s.Scopes[1] != "write" {
+		t.Fatalf("expected scopes [read write], got %v", s.Scopes)
+	}
+
+	// A refresh_token response that omits "scope" means "unchanged" per RFC
+	// 6749 section 6 -- s.Scopes must survive.
+	if _, err := s.applyTokenResponse(map[string]interface{}{
+		"access_token": "tok-2",
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(s.Scopes) != 2 || s.Scopes[0] != "read" || s.Scopes[1] != "write" {
+		t.Fatalf("expected scopes to survive an omitted \"scope\" field, got %v", s.Scopes)
+	}
+}
+
+func TestWithScopesRejectsAuthorizationCodeSession(t *testing.T) {
+	s := &Session{
+		Config: &Config{GrantType: "authorization_code"},
+		Scopes: []string{"openid", "registry"},
+	}
+
+	if _, err := s.WithScopes("registry"); err == nil {
+		t.Fatal("expected WithScopes to reject a session it cannot re-derive")
+	}
+}
+
+func TestWithScopesRejectsUngrantedScope(t *testing.T) {
+	s := &Session{
+		Config: &Config{GrantType: "client_credentials"},
+		Scopes: []string{"openid"},
+	}
+
+	_, err := s.WithScopes("registry")
+	if err == nil {
+		t.Fatal("expected an error for an ungranted scope")
+	}
+
+	if _, ok := err.(*ErrInsufficientScope); !ok {
+		t.Fatalf("expected *ErrInsufficientScope, got %T: %v", err, err)
+	}
+}
+
+func TestWithScopesNarrowsGrantedSession(t *testing.T) {
+	var gotScope string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		gotScope = r.PostFormValue("scope")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"narrow-tok","scope":"registry"}`))
+	}))
+	defer srv.Close()
+
+	s := &Session{
+		Config: &Config{
+			ClientId:     "clientid",
+			ClientSecret: "clientsecret",
+			GrantType:    "client_credentials",
+			BaseApiUrl:   srv.URL,
+			ApiVersion:   -1,
+			UseForm:      true,
+		},
+		Scopes: []string{"openid", "registry"},
+	}
+
+	derived, err := s.WithScopes("registry")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if gotScope != "registry" {
+		t.Errorf("expected the derived session to request scope=registry, got %q", gotScope)
+	}
+
+	if derived.AccessToken != "narrow-tok" {
+		t.Errorf("expected derived session to carry the narrowed token, got %q", derived.AccessToken)
+	}
+
+	if derived == s {
+		t.Error("expected WithScopes to return a new Session, not mutate the original")
+	}
+}
+
+func TestWithScopesDoesNotShareTokenCache(t *testing.T) {
+	cache := &fileTokenCache{path: filepath.Join(t.TempDir(), "tokens.json")}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"narrow-tok","scope":"registry"}`))
+	}))
+	defer srv.Close()
+
+	cnf := &Config{
+		ClientId:     "clientid",
+		ClientSecret: "clientsecret",
+		GrantType:    "client_credentials",
+		BaseApiUrl:   srv.URL,
+		ApiVersion:   -1,
+		UseForm:      true,
+		TokenCache:   cache,
+	}
+
+	if err := cache.Save(cacheKey(cnf), Token{AccessToken: "broad-tok"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	s := &Session{Config: cnf, Scopes: []string{"openid", "registry"}}
+
+	derived, err := s.WithScopes("registry")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if derived.Config.TokenCache != nil {
+		t.Fatal("expected the derived session's Config.TokenCache to be cleared")
+	}
+
+	derived.cacheStore()
+
+	tok, err := cache.Load(cacheKey(cnf))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if tok.AccessToken != "broad-tok" {
+		t.Errorf("expected the broad session's cache entry to survive a derived-session refresh, got %q", tok.AccessToken)
+	}
+}
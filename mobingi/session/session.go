@@ -2,6 +2,12 @@ package session
 
 import (
 	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -9,11 +15,23 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/mobingi/gosdk/pkg/httpclient"
 	"github.com/pkg/errors"
 )
 
+// DefaultRefreshLeeway is how far ahead of actual expiry Token() will
+// proactively refresh the access token when no Config.RefreshLeeway is set.
+const DefaultRefreshLeeway = 60 * time.Second
+
+// defaultHttpClientTimeout matches the timeout httpclient.NewSimpleHttpClient
+// applies when called with no Config -- synthesizing a Config to carry TLS
+// options must not silently drop it.
+const defaultHttpClientTimeout = 120 * time.Second
+
 const (
 	BASE_API_URL      = "https://api.mobingi.com"
 	BASE_REGISTRY_URL = "https://registry.mobingi.com"
@@ -27,6 +45,10 @@ type authPayload struct {
 	Scope        string      `json:"scope,omitempty"`
 	Username     interface{} `json:"username,omitempty"`
 	Password     interface{} `json:"password,omitempty"`
+	RefreshToken string      `json:"refresh_token,omitempty"`
+	Code         string      `json:"code,omitempty"`
+	CodeVerifier string      `json:"code_verifier,omitempty"`
+	RedirectURI  string      `json:"redirect_uri,omitempty"`
 }
 
 type Config struct {
@@ -38,12 +60,20 @@ type Config struct {
 	// MOBINGI_CLIENT_SECRET environment variable.
 	ClientSecret string
 
-	// GrantType can either be 'client_credentials' or 'password'.
+	// GrantType can be 'client_credentials', 'password', or 'authorization_code'.
 	GrantType string
 
-	// Scope is the scope of the JWT being requested. For now, this is set to
-	// 'openid'.
-	Scope string
+	// RedirectURI is the callback URL registered with your client, used for the
+	// 'authorization_code' grant. Required by NewAuthCodeURL and ExchangeCode.
+	RedirectURI string
+
+	// AuthorizationEndpoint is the URL NewAuthCodeURL sends the user to for the
+	// 'authorization_code' grant. Defaults to "${BaseApiUrl}/authorize".
+	AuthorizationEndpoint string
+
+	// Scopes is the list of scopes of the JWT being requested, serialized as a
+	// space-separated string per RFC 6749. Defaults to []string{"openid"}.
+	Scopes []string
 
 	// Username is your Mobingi subuser name. If empty, it means the login grant
 	// type is 'client_credentials'.
@@ -79,11 +109,88 @@ type Config struct {
 	// HttpClientConfig will set the config for the session's http client. Do not
 	// set if you want to use http client defaults.
 	HttpClientConfig *httpclient.Config
+
+	// RefreshLeeway is how far ahead of actual expiry Token() will proactively
+	// mint a new access token via the refresh_token grant. Defaults to
+	// DefaultRefreshLeeway when zero.
+	RefreshLeeway time.Duration
+
+	// OnTokenRefresh, if set, is called with the old and new access token
+	// whenever Token() refreshes the access token.
+	OnTokenRefresh func(old, new string)
+
+	// TokenCache, if set, is consulted before hitting /access_token in New()
+	// and written back to after a successful fetch or refresh. See
+	// EnableDefaultCache to use the default on-disk cache without
+	// constructing one yourself.
+	TokenCache TokenCache
+
+	// EnableDefaultCache, if true and TokenCache is nil, wires up the default
+	// file-based TokenCache from NewFileTokenCache.
+	EnableDefaultCache bool
+
+	// ClientAuthMethod controls how ClientId/ClientSecret are sent to the
+	// token endpoint: "body" (default) includes them in the request body,
+	// "basic" sends them via the Authorization: Basic header instead (RFC
+	// 6749 section 2.3.1), and "none" omits them entirely for public clients.
+	ClientAuthMethod string
+
+	// InsecureSkipVerify disables TLS certificate verification for the token
+	// endpoint. Never enable this in production; Logger, if set, is used to
+	// emit a warning whenever this is true so it cannot be turned on silently.
+	InsecureSkipVerify bool
+
+	// CAFile is a path to a PEM-encoded CA bundle to trust in addition to the
+	// system roots, for on-premises deployments signed by a private CA.
+	CAFile string
+
+	// ClientCert and ClientKey are paths to a PEM-encoded client certificate
+	// and key pair to present for mutual TLS against the token endpoint. Both
+	// must be set together.
+	ClientCert string
+	ClientKey  string
+
+	// Logger, if set, receives warnings such as InsecureSkipVerify being
+	// enabled. Defaults to no-op.
+	Logger func(msg string)
 }
 
 type Session struct {
-	Config      *Config
-	AccessToken string
+	Config       *Config
+	AccessToken  string
+	RefreshToken string
+	ExpiresAt    time.Time
+
+	// Scopes is the list of scopes actually granted by the token endpoint for
+	// AccessToken, as reported in the token response's "scope" field.
+	Scopes []string
+
+	// tokenMu guards AccessToken/RefreshToken/ExpiresAt/Scopes against
+	// concurrent read-check-refresh-write from Token(), since a long-running
+	// process is exactly the case that calls Token()/SimpleAuthRequest from
+	// more than one goroutine.
+	tokenMu sync.Mutex
+}
+
+// ErrInsufficientScope is returned by SimpleAuthRequest when the session's
+// granted scopes do not include a caller-declared required scope.
+type ErrInsufficientScope struct {
+	Required string
+	Granted  []string
+}
+
+func (e *ErrInsufficientScope) Error() string {
+	return fmt.Sprintf("token does not have required scope %q (granted: %v)", e.Required, e.Granted)
+}
+
+func hasScope(granted []string, want string) bool {
+	for _, g := range granted {
+		if g == want {
+			return true
+		}
+	}
+
+	return false
 }
 
 func (s *Session) ApiEndpoint() string {
@@ -103,147 +210,576 @@ func (s *Session) Sesha3Endpoint() string {
 	return s.Config.Sesha3Url
 }
 
-func (s *Session) SimpleAuthRequest(m, u string, body io.Reader) *http.Request {
-	req, err := http.NewRequest(m, u, body)
+// SimpleAuthRequest builds an authenticated request using context.Background().
+//
+// Deprecated: use SimpleAuthRequestContext, which accepts a caller-provided
+// context and surfaces errors (e.g. *ErrInsufficientScope) instead of
+// silently returning nil.
+func (s *Session) SimpleAuthRequest(m, u string, body io.Reader, requiredScope ...string) *http.Request {
+	req, err := s.SimpleAuthRequestContext(context.Background(), m, u, body, requiredScope...)
 	if err != nil {
 		return nil
 	}
 
-	req.Header.Add("Authorization", "Bearer "+s.AccessToken)
 	return req
 }
 
-func (s *Session) getAccessToken() (string, error) {
+// SimpleAuthRequestContext builds an *http.Request for m/u carrying a
+// current "Authorization: Bearer" header, minted or refreshed via Token(ctx).
+// If requiredScope is given, the first value must be present in the
+// session's granted Scopes or a *ErrInsufficientScope is returned instead of
+// attaching the token.
+func (s *Session) SimpleAuthRequestContext(ctx context.Context, m, u string, body io.Reader, requiredScope ...string) (*http.Request, error) {
+	s.tokenMu.Lock()
+	granted := s.Scopes
+	s.tokenMu.Unlock()
+
+	if len(requiredScope) > 0 && !hasScope(granted, requiredScope[0]) {
+		return nil, &ErrInsufficientScope{Required: requiredScope[0], Granted: granted}
+	}
+
+	req, err := http.NewRequest(m, u, body)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := s.Token(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "get token failed")
+	}
+
+	req.Header.Add("Authorization", "Bearer "+token)
+	return req, nil
+}
+
+// Token returns a valid access token. When the current one is within
+// Config.RefreshLeeway (default DefaultRefreshLeeway) of expiring, it is
+// transparently re-minted: via the refresh_token grant if a refresh token is
+// on file, or via a full re-auth (same grant type/credentials as the
+// session was created with) otherwise -- e.g. every client_credentials
+// grant, since RFC 6749 never returns a refresh token for it. Safe for
+// concurrent use.
+func (s *Session) Token(ctx context.Context) (string, error) {
+	s.tokenMu.Lock()
+	defer s.tokenMu.Unlock()
+
+	if s.AccessToken != "" && s.ExpiresAt.IsZero() {
+		return s.AccessToken, nil
+	}
+
+	leeway := s.Config.RefreshLeeway
+	if leeway == 0 {
+		leeway = DefaultRefreshLeeway
+	}
+
+	if s.AccessToken != "" && !time.Now().Add(leeway).After(s.ExpiresAt) {
+		return s.AccessToken, nil
+	}
+
+	old := s.AccessToken
+	if s.RefreshToken != "" {
+		if err := s.refreshAccessToken(ctx); err != nil {
+			return "", errors.Wrap(err, "refresh access token failed")
+		}
+	} else if s.Config.GrantType == "authorization_code" {
+		// getAccessToken cannot redo an authorization_code grant; without a
+		// refresh token the user has to go through NewAuthCodeURL again.
+		return "", errors.New("access token expired and no refresh token is available for this authorization_code session")
+	} else {
+		// No refresh token on file -- true of every client_credentials grant,
+		// since RFC 6749 never issues one for that grant type -- so the only
+		// way to get a live token back is a full re-auth.
+		if _, err := s.getAccessToken(); err != nil {
+			return "", errors.Wrap(err, "get access token failed")
+		}
+	}
+
+	s.cacheStore()
+
+	if s.Config.OnTokenRefresh != nil {
+		s.Config.OnTokenRefresh(old, s.AccessToken)
+	}
+
+	return s.AccessToken, nil
+}
+
+// usesCustomTLS reports whether c declares any TLS setting that requires
+// building a dedicated *http.Client instead of using the default one.
+func usesCustomTLS(c *Config) bool {
+	return c.InsecureSkipVerify || c.CAFile != "" || c.ClientCert != "" || c.ClientKey != ""
+}
+
+// tlsClient builds the *http.Client the token endpoint is called with,
+// honoring Config.InsecureSkipVerify, Config.CAFile, and Config.ClientCert/
+// ClientKey. It returns http.DefaultClient unchanged when none of those are
+// set.
+func tlsClient(c *Config) (*http.Client, error) {
+	if !usesCustomTLS(c) {
+		return http.DefaultClient, nil
+	}
+
+	if c.InsecureSkipVerify {
+		if c.Logger != nil {
+			c.Logger("WARNING: TLS certificate verification is disabled (InsecureSkipVerify); do not use in production")
+		}
+	}
+
+	tc := &tls.Config{InsecureSkipVerify: c.InsecureSkipVerify}
+
+	if c.CAFile != "" {
+		pem, err := ioutil.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "read ca file failed")
+		}
+
+		// Start from the system trust store so CAFile supplements it rather
+		// than replacing it; fall back to an empty pool if it's unavailable.
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificates found in ca file")
+		}
+
+		tc.RootCAs = pool
+	}
+
+	if c.ClientCert != "" || c.ClientKey != "" {
+		cert, err := tls.LoadX509KeyPair(c.ClientCert, c.ClientKey)
+		if err != nil {
+			return nil, errors.Wrap(err, "load client cert/key failed")
+		}
+
+		tc.Certificates = []tls.Certificate{cert}
+	}
+
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: tc}}, nil
+}
+
+// jsonHttpClientConfig returns the *httpclient.Config to call the JSON-mode
+// token endpoint with, carrying httpClient when Config declares custom TLS
+// options. When no caller-supplied Config.HttpClientConfig exists in that
+// case, it is synthesized with defaultHttpClientTimeout so that opting into
+// TLS options doesn't silently drop the request timeout
+// httpclient.NewSimpleHttpClient() would otherwise apply.
+func jsonHttpClientConfig(c *Config, httpClient *http.Client) *httpclient.Config {
+	hcCnf := c.HttpClientConfig
+	if usesCustomTLS(c) {
+		cnfCopy := httpclient.Config{Timeout: defaultHttpClientTimeout}
+		if hcCnf != nil {
+			cnfCopy = *hcCnf
+		}
+
+		cnfCopy.Client = httpClient
+		hcCnf = &cnfCopy
+	}
+
+	return hcCnf
+}
+
+// sendAuthPayload posts p to the /access_token endpoint, honoring
+// Config.UseForm, and returns the decoded JSON response body.
+func (s *Session) sendAuthPayload(ctx context.Context, p *authPayload) (map[string]interface{}, error) {
 	var err error
-	var token string
-	var p *authPayload
 	var body []byte
 	var resp *http.Response
-	var res *httpclient.Response
 	accessTokenUrl := s.ApiEndpoint() + "/access_token"
-	if s.Config.Scope == "" {
-		s.Config.Scope = "openid"
+
+	httpClient, err := tlsClient(s.Config)
+	if err != nil {
+		return nil, errors.Wrap(err, "build tls client failed")
+	}
+
+	// RFC 6749 section 2.3.1 recommends sending client credentials via HTTP
+	// Basic rather than in the request body; some proxies strip the latter.
+	// "none" is for public clients that have no secret to send at all.
+	clientId, clientSecret := p.ClientId, p.ClientSecret
+	basicAuth := s.Config.ClientAuthMethod == "basic"
+	if basicAuth || s.Config.ClientAuthMethod == "none" {
+		p.ClientId = ""
+		p.ClientSecret = ""
 	}
 
 	if s.Config.UseForm {
 		form := url.Values{}
-		if s.Config.GrantType == "client_credentials" {
-			form.Add("client_id", s.Config.ClientId)
-			form.Add("client_secret", s.Config.ClientSecret)
-			form.Add("grant_type", s.Config.GrantType)
-			form.Add("scope", s.Config.Scope)
+		if p.ClientId != "" {
+			form.Add("client_id", p.ClientId)
 		}
 
-		if s.Config.GrantType == "password" {
-			form.Add("client_id", s.Config.ClientId)
-			form.Add("client_secret", s.Config.ClientSecret)
-			form.Add("grant_type", s.Config.GrantType)
-			form.Add("scope", s.Config.Scope)
-			form.Add("username", s.Config.Username)
-			form.Add("password", s.Config.Password)
+		if p.ClientSecret != "" {
+			form.Add("client_secret", p.ClientSecret)
 		}
 
-		resp, err = http.PostForm(accessTokenUrl, form)
-		if err != nil {
-			return token, errors.Wrap(err, "do failed")
+		form.Add("grant_type", p.GrantType)
+		if p.Scope != "" {
+			form.Add("scope", p.Scope)
 		}
 
-		defer resp.Body.Close()
-		body, err = ioutil.ReadAll(resp.Body)
-	} else {
-		if s.Config.GrantType == "client_credentials" {
-			p = &authPayload{
-				ClientId:     s.Config.ClientId,
-				ClientSecret: s.Config.ClientSecret,
-				GrantType:    "client_credentials",
-				Scope:        s.Config.Scope,
-			}
+		if p.GrantType == "password" {
+			form.Add("username", fmt.Sprintf("%v", p.Username))
+			form.Add("password", fmt.Sprintf("%v", p.Password))
 		}
 
-		if s.Config.GrantType == "password" {
-			p = &authPayload{
-				ClientId:     s.Config.ClientId,
-				ClientSecret: s.Config.ClientSecret,
-				GrantType:    "password",
-				Username:     s.Config.Username,
-				Password:     s.Config.Password,
-				Scope:        s.Config.Scope,
-			}
+		if p.GrantType == "refresh_token" {
+			form.Add("refresh_token", p.RefreshToken)
 		}
 
-		if p == nil {
-			// Let's try to determine the grant type based on current parameters.
-			if s.Config.Username != "" {
-				if s.Config.Password == "" {
-					return token, errors.New("password cannot be empty")
-				}
-
-				p = &authPayload{
-					ClientId:     s.Config.ClientId,
-					ClientSecret: s.Config.ClientSecret,
-					GrantType:    "password",
-					Username:     s.Config.Username,
-					Password:     s.Config.Password,
-				}
-			} else {
-				p = &authPayload{
-					ClientId:     s.Config.ClientId,
-					ClientSecret: s.Config.ClientSecret,
-					GrantType:    "client_credentials",
-				}
-			}
+		if p.GrantType == "authorization_code" {
+			form.Add("code", p.Code)
+			form.Add("code_verifier", p.CodeVerifier)
+			form.Add("redirect_uri", p.RedirectURI)
+		}
+
+		req, err := http.NewRequest(http.MethodPost, accessTokenUrl, bytes.NewBufferString(form.Encode()))
+		if err != nil {
+			return nil, errors.Wrap(err, "new request failed")
+		}
+
+		req = req.WithContext(ctx)
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		if basicAuth {
+			req.SetBasicAuth(url.QueryEscape(clientId), url.QueryEscape(clientSecret))
 		}
 
+		resp, err = httpClient.Do(req)
+		if err != nil {
+			return nil, errors.Wrap(err, "do failed")
+		}
+
+		defer resp.Body.Close()
+		body, err = ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, errors.Wrap(err, "read body failed")
+		}
+	} else {
 		payload, _ := json.Marshal(p)
 		r, err := http.NewRequest(http.MethodPost, accessTokenUrl, bytes.NewBuffer(payload))
 		if err != nil {
-			return token, errors.Wrap(err, "new request failed")
+			return nil, errors.Wrap(err, "new request failed")
 		}
 
+		r = r.WithContext(ctx)
+
+		hcCnf := jsonHttpClientConfig(s.Config, httpClient)
+
 		var c httpclient.HttpClient
-		if s.Config.HttpClientConfig != nil {
-			c = httpclient.NewSimpleHttpClient(s.Config.HttpClientConfig)
+		if hcCnf != nil {
+			c = httpclient.NewSimpleHttpClient(hcCnf)
 		} else {
 			c = httpclient.NewSimpleHttpClient()
 		}
 
 		r.Header.Add("Content-Type", "application/json")
-		res, body, err = c.Do(r)
+		if basicAuth {
+			r.SetBasicAuth(url.QueryEscape(clientId), url.QueryEscape(clientSecret))
+		}
+
+		res, b, err := c.Do(r)
 		if err != nil {
-			return token, errors.Wrap(err, "do failed")
+			return nil, errors.Wrap(err, "do failed")
 		}
 
 		resp = res.Response
+		body = b
 	}
 
 	if (resp.StatusCode / 100) != 2 {
-		return token, errors.New(resp.Status)
+		return nil, errors.New(resp.Status)
 	}
 
 	var m map[string]interface{}
 	if err = json.Unmarshal(body, &m); err != nil {
-		return token, errors.Wrap(err, "unmarshal failed")
+		return nil, errors.Wrap(err, "unmarshal failed")
 	}
 
+	return m, nil
+}
+
+// applyTokenResponse stores the access token, refresh token (if any), and
+// expiry (if any) from a decoded /access_token response onto the session,
+// and returns the access token.
+func (s *Session) applyTokenResponse(m map[string]interface{}) (string, error) {
 	t, found := m["access_token"]
 	if !found {
-		return token, fmt.Errorf("cannot find access token")
+		return "", fmt.Errorf("cannot find access token")
+	}
+
+	s.AccessToken = fmt.Sprintf("%s", t)
+
+	if rt, found := m["refresh_token"]; found {
+		s.RefreshToken = fmt.Sprintf("%s", rt)
 	}
 
-	token = fmt.Sprintf("%s", t)
-	return token, nil
+	// Per RFC 6749 section 6, a refresh_token response commonly omits "scope"
+	// to mean "unchanged from the original grant" -- so only overwrite
+	// s.Scopes when the response explicitly includes one.
+	if sc, found := m["scope"]; found {
+		if str, ok := sc.(string); ok {
+			s.Scopes = strings.Fields(str)
+		}
+	}
+
+	s.ExpiresAt = time.Time{}
+	if ei, found := m["expires_in"]; found {
+		if secs, ok := ei.(float64); ok {
+			s.ExpiresAt = time.Now().Add(time.Duration(secs) * time.Second)
+		}
+	}
+
+	return s.AccessToken, nil
+}
+
+// refreshAccessToken re-mints the access token via the refresh_token grant
+// and stores the result on the session.
+func (s *Session) refreshAccessToken(ctx context.Context) error {
+	p := &authPayload{
+		ClientId:     s.Config.ClientId,
+		ClientSecret: s.Config.ClientSecret,
+		GrantType:    "refresh_token",
+		RefreshToken: s.RefreshToken,
+	}
+
+	m, err := s.sendAuthPayload(ctx, p)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.applyTokenResponse(m)
+	return err
+}
+
+func (s *Session) getAccessToken() (string, error) {
+	var p *authPayload
+	if len(s.Config.Scopes) == 0 {
+		s.Config.Scopes = []string{"openid"}
+	}
+
+	scope := strings.Join(s.Config.Scopes, " ")
+	if s.Config.GrantType == "client_credentials" {
+		p = &authPayload{
+			ClientId:     s.Config.ClientId,
+			ClientSecret: s.Config.ClientSecret,
+			GrantType:    "client_credentials",
+			Scope:        scope,
+		}
+	}
+
+	if s.Config.GrantType == "password" {
+		p = &authPayload{
+			ClientId:     s.Config.ClientId,
+			ClientSecret: s.Config.ClientSecret,
+			GrantType:    "password",
+			Username:     s.Config.Username,
+			Password:     s.Config.Password,
+			Scope:        scope,
+		}
+	}
+
+	if p == nil {
+		// Let's try to determine the grant type based on current parameters.
+		if s.Config.Username != "" {
+			if s.Config.Password == "" {
+				return "", errors.New("password cannot be empty")
+			}
+
+			p = &authPayload{
+				ClientId:     s.Config.ClientId,
+				ClientSecret: s.Config.ClientSecret,
+				GrantType:    "password",
+				Username:     s.Config.Username,
+				Password:     s.Config.Password,
+				Scope:        scope,
+			}
+		} else {
+			p = &authPayload{
+				ClientId:     s.Config.ClientId,
+				ClientSecret: s.Config.ClientSecret,
+				GrantType:    "client_credentials",
+				Scope:        scope,
+			}
+		}
+	}
+
+	m, err := s.sendAuthPayload(context.Background(), p)
+	if err != nil {
+		return "", err
+	}
+
+	return s.applyTokenResponse(m)
+}
+
+// WithScopes mints a new, derived Session narrowed to the given scopes by
+// re-authenticating against the same grant type and credentials as s. This
+// lets an application holding a broadly-scoped token hand a scope-restricted
+// token to a subsystem (e.g. registry, sesha3) that only needs one
+// capability. Every requested scope must already be present in s.Scopes, or
+// an *ErrInsufficientScope is returned.
+func (s *Session) WithScopes(scopes ...string) (*Session, error) {
+	switch s.Config.GrantType {
+	case "", "client_credentials", "password":
+		// getAccessToken can re-derive these (including the Username-based
+		// heuristic it falls back to when GrantType is unset).
+	default:
+		return nil, fmt.Errorf("WithScopes: cannot re-authenticate a %q-derived session; re-narrow scopes via that grant's own flow instead", s.Config.GrantType)
+	}
+
+	for _, sc := range scopes {
+		if !hasScope(s.Scopes, sc) {
+			return nil, &ErrInsufficientScope{Required: sc, Granted: s.Scopes}
+		}
+	}
+
+	c := *s.Config
+	c.Scopes = scopes
+
+	// cacheKey doesn't factor in scope, so a derived, narrower-scoped Session
+	// refreshing through Token() would otherwise overwrite s's broader cache
+	// entry under the same key. Drop the cache on the copy; callers that want
+	// the derived session cached need to set its own Config.TokenCache.
+	c.TokenCache = nil
+
+	derived := &Session{Config: &c}
+	if _, err := derived.getAccessToken(); err != nil {
+		return nil, errors.Wrap(err, "get access token failed")
+	}
+
+	return derived, nil
+}
+
+// generateCodeVerifier returns a 43-octet high-entropy PKCE code_verifier, as
+// required by RFC 7636 section 4.1.
+func generateCodeVerifier() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// codeChallengeS256 derives the PKCE code_challenge for verifier using the
+// S256 transform from RFC 7636 section 4.2.
+func codeChallengeS256(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// NewAuthCodeURL builds the authorization URL for the 'authorization_code'
+// grant with PKCE (RFC 7636): it generates a code_verifier, derives the
+// corresponding S256 code_challenge, and returns the URL to send the user's
+// browser to. Callers must hold on to the returned codeVerifier and pass it
+// to ExchangeCode once the authorization server redirects back with a code.
+func NewAuthCodeURL(cnf *Config, state string) (authURL string, codeVerifier string, err error) {
+	if cnf == nil {
+		return "", "", errors.New("config cannot be nil")
+	}
+
+	codeVerifier, err = generateCodeVerifier()
+	if err != nil {
+		return "", "", errors.Wrap(err, "generate code verifier failed")
+	}
+
+	endpoint := cnf.AuthorizationEndpoint
+	if endpoint == "" {
+		baseApiUrl := cnf.BaseApiUrl
+		if baseApiUrl == "" {
+			baseApiUrl = BASE_API_URL
+		}
+
+		endpoint = baseApiUrl + "/authorize"
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", "", errors.Wrap(err, "parse authorization endpoint failed")
+	}
+
+	q := u.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", cnf.ClientId)
+	q.Set("redirect_uri", cnf.RedirectURI)
+	q.Set("code_challenge", codeChallengeS256(codeVerifier))
+	q.Set("code_challenge_method", "S256")
+	q.Set("state", state)
+	scopes := cnf.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"openid"}
+	}
+
+	q.Set("scope", strings.Join(scopes, " "))
+
+	u.RawQuery = q.Encode()
+	return u.String(), codeVerifier, nil
+}
+
+// applyDefaultEndpoints fills in c's BaseApiUrl, ApiVersion, BaseRegistryUrl,
+// and Sesha3Url when left at their zero value, matching New()'s defaults.
+// ExchangeCode uses this too, since it builds a Session without going
+// through New() first.
+func applyDefaultEndpoints(c *Config) {
+	if c.BaseApiUrl == "" {
+		c.BaseApiUrl = BASE_API_URL
+	}
+
+	if c.ApiVersion == 0 {
+		c.ApiVersion = 3
+	}
+
+	if c.BaseRegistryUrl == "" {
+		c.BaseRegistryUrl = BASE_REGISTRY_URL
+	}
+
+	if c.Sesha3Url == "" {
+		c.Sesha3Url = SESHA3_URL
+	}
+}
+
+// ExchangeCode completes the 'authorization_code' grant: it exchanges code
+// and the codeVerifier returned by NewAuthCodeURL for an access token and
+// returns the resulting Session.
+func ExchangeCode(cnf *Config, code, codeVerifier string) (*Session, error) {
+	if cnf == nil {
+		return nil, errors.New("config cannot be nil")
+	}
+
+	c := *cnf
+	applyDefaultEndpoints(&c)
+
+	// Recorded on the session so a later WithScopes call knows it cannot
+	// re-derive this grant and must reject instead of re-authenticating as
+	// whatever ClientId/Username/Password happen to be set.
+	c.GrantType = "authorization_code"
+
+	s := &Session{Config: &c}
+	p := &authPayload{
+		ClientId:     c.ClientId,
+		ClientSecret: c.ClientSecret,
+		GrantType:    "authorization_code",
+		Code:         code,
+		CodeVerifier: codeVerifier,
+		RedirectURI:  c.RedirectURI,
+	}
+
+	m, err := s.sendAuthPayload(context.Background(), p)
+	if err != nil {
+		return nil, errors.Wrap(err, "exchange code failed")
+	}
+
+	if _, err := s.applyTokenResponse(m); err != nil {
+		return nil, err
+	}
+
+	return s, nil
 }
 
 func New(cnf ...*Config) (*Session, error) {
 	c := &Config{
-		ClientId:        os.Getenv("MOBINGI_CLIENT_ID"),
-		ClientSecret:    os.Getenv("MOBINGI_CLIENT_SECRET"),
-		Username:        os.Getenv("MOBINGI_USERNAME"),
-		Password:        os.Getenv("MOBINGI_PASSWORD"),
-		ApiVersion:      3,
-		BaseApiUrl:      BASE_API_URL,
-		BaseRegistryUrl: BASE_REGISTRY_URL,
-		Sesha3Url:       SESHA3_URL,
+		ClientId:     os.Getenv("MOBINGI_CLIENT_ID"),
+		ClientSecret: os.Getenv("MOBINGI_CLIENT_SECRET"),
+		Username:     os.Getenv("MOBINGI_USERNAME"),
+		Password:     os.Getenv("MOBINGI_PASSWORD"),
 	}
 
 	if len(cnf) > 0 {
@@ -264,8 +800,8 @@ func New(cnf ...*Config) (*Session, error) {
 				c.GrantType = cnf[0].GrantType
 			}
 
-			if cnf[0].Scope != "" {
-				c.Scope = cnf[0].Scope
+			if len(cnf[0].Scopes) > 0 {
+				c.Scopes = cnf[0].Scopes
 			}
 
 			if cnf[0].Username != "" {
@@ -299,20 +835,125 @@ func New(cnf ...*Config) (*Session, error) {
 			if cnf[0].HttpClientConfig != nil {
 				c.HttpClientConfig = cnf[0].HttpClientConfig
 			}
+
+			if cnf[0].RefreshLeeway != 0 {
+				c.RefreshLeeway = cnf[0].RefreshLeeway
+			}
+
+			if cnf[0].OnTokenRefresh != nil {
+				c.OnTokenRefresh = cnf[0].OnTokenRefresh
+			}
+
+			if cnf[0].RedirectURI != "" {
+				c.RedirectURI = cnf[0].RedirectURI
+			}
+
+			if cnf[0].AuthorizationEndpoint != "" {
+				c.AuthorizationEndpoint = cnf[0].AuthorizationEndpoint
+			}
+
+			if cnf[0].TokenCache != nil {
+				c.TokenCache = cnf[0].TokenCache
+			}
+
+			if cnf[0].EnableDefaultCache {
+				c.EnableDefaultCache = cnf[0].EnableDefaultCache
+			}
+
+			if cnf[0].ClientAuthMethod != "" {
+				c.ClientAuthMethod = cnf[0].ClientAuthMethod
+			}
+
+			if cnf[0].InsecureSkipVerify {
+				c.InsecureSkipVerify = cnf[0].InsecureSkipVerify
+			}
+
+			if cnf[0].CAFile != "" {
+				c.CAFile = cnf[0].CAFile
+			}
+
+			if cnf[0].ClientCert != "" {
+				c.ClientCert = cnf[0].ClientCert
+			}
+
+			if cnf[0].ClientKey != "" {
+				c.ClientKey = cnf[0].ClientKey
+			}
+
+			if cnf[0].Logger != nil {
+				c.Logger = cnf[0].Logger
+			}
 		}
 	}
 
+	applyDefaultEndpoints(c)
+
+	if c.TokenCache == nil && c.EnableDefaultCache {
+		fc, err := NewFileTokenCache()
+		if err != nil {
+			return nil, errors.Wrap(err, "new file token cache failed")
+		}
+
+		c.TokenCache = fc
+	}
+
 	s := &Session{Config: c}
 	if c.AccessToken != "" {
 		s.AccessToken = c.AccessToken
 		return s, nil
 	}
 
+	if c.TokenCache != nil {
+		if s2, ok := s.fromCache(); ok {
+			return s2, nil
+		}
+	}
+
 	token, err := s.getAccessToken()
 	if err != nil {
 		return s, errors.Wrap(err, "get access token failed")
 	}
 
 	s.AccessToken = token
+	s.cacheStore()
 	return s, nil
 }
+
+// fromCache tries to satisfy s from Config.TokenCache: a cached token that
+// is not near expiry is used as-is, one that is refreshable is refreshed in
+// place, and anything else is reported as a miss so the caller falls back to
+// a full re-auth.
+func (s *Session) fromCache() (*Session, bool) {
+	tok, err := s.Config.TokenCache.Load(cacheKey(s.Config))
+	if err != nil {
+		return nil, false
+	}
+
+	s.AccessToken = tok.AccessToken
+	s.RefreshToken = tok.RefreshToken
+	s.ExpiresAt = tok.ExpiresAt
+	s.Scopes = tok.Scopes
+	if s.AccessToken == "" {
+		return nil, false
+	}
+
+	leeway := s.Config.RefreshLeeway
+	if leeway == 0 {
+		leeway = DefaultRefreshLeeway
+	}
+
+	if s.ExpiresAt.IsZero() || time.Now().Add(leeway).Before(s.ExpiresAt) {
+		return s, true
+	}
+
+	if s.RefreshToken == "" {
+		return nil, false
+	}
+
+	if err := s.refreshAccessToken(context.Background()); err != nil {
+		return nil, false
+	}
+
+	s.cacheStore()
+	return s, true
+}
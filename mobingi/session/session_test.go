@@ -0,0 +1,143 @@
+package session
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// newAuthTestServer returns an httptest.Server that always answers
+// /access_token with a minimal token response, and a pointer to the last
+// request it received so the caller can assert on its form values and
+// headers.
+func newAuthTestServer() (*httptest.Server, **http.Request) {
+	var last *http.Request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		last = r
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"tok-123"}`))
+	}))
+
+	return srv, &last
+}
+
+func TestGetAccessTokenClientAuthMethod(t *testing.T) {
+	grantTypes := []string{"client_credentials", "password", "refresh_token"}
+	authMethods := []string{"body", "basic"}
+
+	for _, gt := range grantTypes {
+		for _, am := range authMethods {
+			srv, last := newAuthTestServer()
+
+			c := &Config{
+				ClientId:         "clientid",
+				ClientSecret:     "clientsecret",
+				GrantType:        gt,
+				Username:         "user",
+				Password:         "pass",
+				BaseApiUrl:       srv.URL,
+				ApiVersion:       -1,
+				UseForm:          true,
+				ClientAuthMethod: am,
+			}
+
+			s := &Session{Config: c}
+
+			var err error
+			switch gt {
+			case "refresh_token":
+				s.RefreshToken = "rt-123"
+				err = s.refreshAccessToken(context.Background())
+			default:
+				_, err = s.getAccessToken()
+			}
+
+			srv.Close()
+
+			if err != nil {
+				t.Fatalf("grant=%s auth=%s: unexpected error: %v", gt, am, err)
+			}
+
+			req := *last
+			if req == nil {
+				t.Fatalf("grant=%s auth=%s: server saw no request", gt, am)
+			}
+
+			wantBasic := am == "basic"
+			_, _, hasBasic := req.BasicAuth()
+			if hasBasic != wantBasic {
+				t.Errorf("grant=%s auth=%s: BasicAuth present=%v, want %v", gt, am, hasBasic, wantBasic)
+			}
+
+			if wantBasic {
+				user, pass, _ := req.BasicAuth()
+				if user != url.QueryEscape("clientid") || pass != url.QueryEscape("clientsecret") {
+					t.Errorf("grant=%s auth=%s: got basic auth %s:%s", gt, am, user, pass)
+				}
+
+				if req.PostFormValue("client_id") != "" || req.PostFormValue("client_secret") != "" {
+					t.Errorf("grant=%s auth=%s: client credentials leaked into body", gt, am)
+				}
+			} else {
+				if req.PostFormValue("client_id") != "clientid" {
+					t.Errorf("grant=%s auth=%s: expected client_id in body, got %q", gt, am, req.PostFormValue("client_id"))
+				}
+
+				if req.PostFormValue("client_secret") != "clientsecret" {
+					t.Errorf("grant=%s auth=%s: expected client_secret in body, got %q", gt, am, req.PostFormValue("client_secret"))
+				}
+			}
+
+			if s.AccessToken != "tok-123" {
+				t.Errorf("grant=%s auth=%s: expected access token to be set, got %q", gt, am, s.AccessToken)
+			}
+		}
+	}
+}
+
+func TestSendAuthPayloadBasicAuthEncodesCredentials(t *testing.T) {
+	srv, last := newAuthTestServer()
+	defer srv.Close()
+
+	s := &Session{Config: &Config{
+		ClientId:         "client id",
+		ClientSecret:     "client secret",
+		BaseApiUrl:       srv.URL,
+		ApiVersion:       -1,
+		UseForm:          true,
+		ClientAuthMethod: "basic",
+	}}
+
+	p := &authPayload{
+		ClientId:     s.Config.ClientId,
+		ClientSecret: s.Config.ClientSecret,
+		GrantType:    "client_credentials",
+	}
+
+	if _, err := s.sendAuthPayload(context.Background(), p); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	req := *last
+	user, pass, ok := req.BasicAuth()
+	if !ok {
+		t.Fatal("expected basic auth header")
+	}
+
+	if user != url.QueryEscape("client id") || pass != url.QueryEscape("client secret") {
+		t.Errorf("expected url-encoded credentials, got %s:%s", user, pass)
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(req.Header.Get("Authorization")[len("Basic "):])
+	if err != nil {
+		t.Fatalf("decode Authorization header failed: %v", err)
+	}
+
+	if string(decoded) != url.QueryEscape("client id")+":"+url.QueryEscape("client secret") {
+		t.Errorf("unexpected decoded Authorization header: %s", decoded)
+	}
+}
@@ -0,0 +1,101 @@
+package session
+
+import (
+	"crypto/x509"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/mobingi/gosdk/pkg/httpclient"
+)
+
+var httpClientConfigFixture = httpclient.Config{Timeout: 5 * time.Second}
+
+// testCACert is a self-signed PEM certificate used only as pool filler; it
+// never needs to validate a real TLS handshake in these tests.
+const testCACert = `-----BEGIN CERTIFICATE-----
+MIIC/zCCAeegAwIBAgIUFT4hRH8hclqPkrKIknJkZ74DrHYwDQYJKoZIhvcNAQEL
+BQAwDzENMAsGA1UEAwwEdGVzdDAeFw0yNjA3MjYwNDUxMjFaFw0zNjA3MjMwNDUx
+MjFaMA8xDTALBgNVBAMMBHRlc3QwggEiMA0GCSqGSIb3DQEBAQUAA4IBDwAwggEK
+AoIBAQDnHTclErurqh+jfdaEpmB8abGvUo0VdJ90F/rOBemfc8ARIHaj04lh8wtS
+nqpDSHQ8UL9BFCveFa7GY1tdqPvRwDnpT3g99kzGGirEqJP9q0nA2m1N+B8yPwUt
+8O00RZ9ckzYuiCwAX8S8P0T20rlJ098n2wFHUBTA95k3Zh/E5TdiPGPhWVc4NaWa
+NFdw3hWnX6x3ZzEpWepzp33uBR8X/9dzcF+iyLnIMuVLeOVPow6Dm6WHCYCGJBlD
+C77r3JyqXhNamL/0/G9S6I57423bWXoK2uRRCthjcAKPV95O8+ULddGoawS375Gj
+BlJ+mXA+D5DjevvDR2d7XpRe0ylLAgMBAAGjUzBRMB0GA1UdDgQWBBQS8dO+wmCw
+zImvaK05JzLBCfxTbzAfBgNVHSMEGDAWgBQS8dO+wmCwzImvaK05JzLBCfxTbzAP
+BgNVHRMBAf8EBTADAQH/MA0GCSqGSIb3DQEBCwUAA4IBAQDRbA1IwQ+1x8my108d
+nL96d+pmWznWwlCxYL+8NoGRfJtdlODY8DzShfDJCwg6D+hvL8kamPek+0W2BzZi
+vsSKMWS/eHiUVcTD1ZtMOjiNMCzx4nTmHlgv2KmAGdTtY3vpI7r2ZxH53YNnfZKu
+BRUeizDwsgRSR74Zi+SaKtuYfEkXlK1iapzycyyy8CNn7W6EFKds9wEgKDP0E8y7
+vM9Whc9JwInfiWVnkTAw1m3vtYkM7FTpSeyrl7BczS+rjt3PcRcH2loPgkHQy8AC
+IxXKDmM1pHiEahgc+1S0nBAIwHFLlf2G4F0g2V6uFT9PSQglpbGfbt/gB7NnN0nZ
+bxjI
+-----END CERTIFICATE-----`
+
+func TestTlsClientCAFileSupplementsSystemPool(t *testing.T) {
+	f, err := ioutil.TempFile("", "ca*.pem")
+	if err != nil {
+		t.Fatalf("create temp ca file failed: %v", err)
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.WriteString(testCACert); err != nil {
+		t.Fatalf("write ca file failed: %v", err)
+	}
+	f.Close()
+
+	c, err := tlsClient(&Config{CAFile: f.Name()})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	pool := c.Transport.(*http.Transport).TLSClientConfig.RootCAs
+	if pool == nil {
+		t.Fatal("expected a non-nil RootCAs pool")
+	}
+
+	sysPool, err := x509.SystemCertPool()
+	if err == nil && sysPool != nil && len(sysPool.Subjects()) > 0 {
+		if len(pool.Subjects()) <= len(sysPool.Subjects()) {
+			t.Error("expected the custom CA to be appended to, not replace, the system pool")
+		}
+	}
+}
+
+func TestJsonHttpClientConfigPreservesDefaultTimeout(t *testing.T) {
+	c := &Config{InsecureSkipVerify: true}
+
+	hcCnf := jsonHttpClientConfig(c, http.DefaultClient)
+	if hcCnf == nil {
+		t.Fatal("expected a non-nil config when custom TLS options are set")
+	}
+
+	if hcCnf.Timeout != defaultHttpClientTimeout {
+		t.Errorf("expected the synthesized config to keep the default %s timeout, got %s", defaultHttpClientTimeout, hcCnf.Timeout)
+	}
+
+	if hcCnf.Client != http.DefaultClient {
+		t.Error("expected the synthesized config to carry the TLS-configured client")
+	}
+}
+
+func TestJsonHttpClientConfigHonorsCallerTimeout(t *testing.T) {
+	c := &Config{
+		InsecureSkipVerify: true,
+		HttpClientConfig:   &httpClientConfigFixture,
+	}
+
+	hcCnf := jsonHttpClientConfig(c, http.DefaultClient)
+	if hcCnf.Timeout != httpClientConfigFixture.Timeout {
+		t.Errorf("expected caller-supplied timeout %s to be preserved, got %s", httpClientConfigFixture.Timeout, hcCnf.Timeout)
+	}
+}
+
+func TestJsonHttpClientConfigNilWithoutCustomTLS(t *testing.T) {
+	if hcCnf := jsonHttpClientConfig(&Config{}, http.DefaultClient); hcCnf != nil {
+		t.Errorf("expected a nil config when no custom TLS options are set, got %+v", hcCnf)
+	}
+}
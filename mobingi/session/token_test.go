@@ -0,0 +1,101 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// tokenCountingServer answers /access_token with a fresh, uniquely numbered
+// token on every call, and reports how many times it was hit.
+func tokenCountingServer() (*httptest.Server, *int32) {
+	var n int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		i := atomic.AddInt32(&n, 1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":"tok-%d"}`, i)
+	}))
+
+	return srv, &n
+}
+
+func TestTokenFallsBackToReauthWithoutRefreshToken(t *testing.T) {
+	srv, calls := tokenCountingServer()
+	defer srv.Close()
+
+	s := &Session{
+		Config: &Config{
+			ClientId:     "clientid",
+			ClientSecret: "clientsecret",
+			GrantType:    "client_credentials",
+			BaseApiUrl:   srv.URL,
+			ApiVersion:   -1,
+			UseForm:      true,
+		},
+		AccessToken: "stale-token",
+		ExpiresAt:   time.Now().Add(-time.Minute), // already expired
+	}
+
+	tok, err := s.Token(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if tok == "stale-token" {
+		t.Fatal("expected Token to re-authenticate instead of returning the stale token")
+	}
+
+	if *calls != 1 {
+		t.Fatalf("expected exactly one call to /access_token, got %d", *calls)
+	}
+}
+
+func TestTokenConcurrentCallsAreSerialized(t *testing.T) {
+	srv, calls := tokenCountingServer()
+	defer srv.Close()
+
+	s := &Session{
+		Config: &Config{
+			ClientId:     "clientid",
+			ClientSecret: "clientsecret",
+			GrantType:    "client_credentials",
+			BaseApiUrl:   srv.URL,
+			ApiVersion:   -1,
+			UseForm:      true,
+		},
+		AccessToken: "stale-token",
+		ExpiresAt:   time.Now().Add(-time.Minute),
+	}
+
+	const goroutines = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, goroutines)
+	wg.Add(goroutines)
+	for i := 0; i < goroutines; i++ {
+		go func() {
+			defer wg.Done()
+			if _, err := s.Token(context.Background()); err != nil {
+				errs <- err
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("unexpected error from concurrent Token(): %v", err)
+	}
+
+	if s.AccessToken == "" {
+		t.Fatal("expected a token to be set")
+	}
+
+	if got := atomic.LoadInt32(calls); got != 1 {
+		t.Errorf("expected exactly one /access_token call across %d goroutines, got %d", goroutines, got)
+	}
+}
@@ -0,0 +1,148 @@
+package session
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrCacheMiss is returned by a TokenCache's Load when key is not present.
+var ErrCacheMiss = errors.New("token cache: key not found")
+
+// Token is the cacheable subset of a Session's auth state.
+type Token struct {
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	ExpiresAt    time.Time `json:"expires_at,omitempty"`
+	Scopes       []string  `json:"scopes,omitempty"`
+}
+
+// TokenCache persists Tokens across process invocations, keyed by an
+// arbitrary caller-chosen string. See NewFileTokenCache for the default
+// on-disk implementation.
+type TokenCache interface {
+	Load(key string) (Token, error)
+	Save(key string, tok Token) error
+	Delete(key string) error
+}
+
+// fileTokenCache is the default TokenCache, backed by a single JSON file
+// holding a map of cache key to Token.
+type fileTokenCache struct {
+	path string
+}
+
+// NewFileTokenCache returns the default file-based TokenCache, rooted at
+// $XDG_CACHE_HOME/mobingi/tokens.json (falling back to ~/.cache/mobingi when
+// XDG_CACHE_HOME is unset). The file and its containing directory are
+// created with 0600/0700 permissions since it holds live access tokens.
+func NewFileTokenCache() (*fileTokenCache, error) {
+	dir := os.Getenv("XDG_CACHE_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, errors.Wrap(err, "user home dir failed")
+		}
+
+		dir = filepath.Join(home, ".cache")
+	}
+
+	dir = filepath.Join(dir, "mobingi")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, errors.Wrap(err, "mkdir failed")
+	}
+
+	return &fileTokenCache{path: filepath.Join(dir, "tokens.json")}, nil
+}
+
+func (c *fileTokenCache) readAll() (map[string]Token, error) {
+	b, err := ioutil.ReadFile(c.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return map[string]Token{}, nil
+		}
+
+		return nil, errors.Wrap(err, "read failed")
+	}
+
+	m := map[string]Token{}
+	if len(b) > 0 {
+		if err := json.Unmarshal(b, &m); err != nil {
+			return nil, errors.Wrap(err, "unmarshal failed")
+		}
+	}
+
+	return m, nil
+}
+
+func (c *fileTokenCache) writeAll(m map[string]Token) error {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "marshal failed")
+	}
+
+	return ioutil.WriteFile(c.path, b, 0600)
+}
+
+func (c *fileTokenCache) Load(key string) (Token, error) {
+	m, err := c.readAll()
+	if err != nil {
+		return Token{}, err
+	}
+
+	tok, found := m[key]
+	if !found {
+		return Token{}, ErrCacheMiss
+	}
+
+	return tok, nil
+}
+
+func (c *fileTokenCache) Save(key string, tok Token) error {
+	m, err := c.readAll()
+	if err != nil {
+		return err
+	}
+
+	m[key] = tok
+	return c.writeAll(m)
+}
+
+func (c *fileTokenCache) Delete(key string) error {
+	m, err := c.readAll()
+	if err != nil {
+		return err
+	}
+
+	delete(m, key)
+	return c.writeAll(m)
+}
+
+// cacheKey derives the TokenCache key for c, so that multiple profiles
+// (e.g. different users against the same client) coexist in one cache file.
+func cacheKey(c *Config) string {
+	sum := sha256.Sum256([]byte(c.ClientId + "|" + c.BaseApiUrl + "|" + c.Username))
+	return hex.EncodeToString(sum[:])
+}
+
+// cacheStore writes the session's current auth state to Config.TokenCache,
+// if one is set. Cache write failures are not fatal to the caller holding a
+// perfectly good token, so they are swallowed.
+func (s *Session) cacheStore() {
+	if s.Config.TokenCache == nil {
+		return
+	}
+
+	_ = s.Config.TokenCache.Save(cacheKey(s.Config), Token{
+		AccessToken:  s.AccessToken,
+		RefreshToken: s.RefreshToken,
+		ExpiresAt:    s.ExpiresAt,
+		Scopes:       s.Scopes,
+	})
+}
@@ -0,0 +1,123 @@
+package session
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileTokenCacheSaveLoadDelete(t *testing.T) {
+	c := &fileTokenCache{path: filepath.Join(t.TempDir(), "tokens.json")}
+
+	if _, err := c.Load("key1"); err != ErrCacheMiss {
+		t.Fatalf("expected ErrCacheMiss on an empty cache, got %v", err)
+	}
+
+	want := Token{
+		AccessToken:  "tok-1",
+		RefreshToken: "rt-1",
+		ExpiresAt:    time.Now().Add(time.Hour).Round(time.Second),
+		Scopes:       []string{"openid", "registry"},
+	}
+
+	if err := c.Save("key1", want); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got, err := c.Load("key1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got.AccessToken != want.AccessToken || got.RefreshToken != want.RefreshToken ||
+		!got.ExpiresAt.Equal(want.ExpiresAt) || len(got.Scopes) != len(want.Scopes) {
+		t.Fatalf("round-tripped token %+v does not match saved token %+v", got, want)
+	}
+
+	if err := c.Delete("key1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := c.Load("key1"); err != ErrCacheMiss {
+		t.Fatalf("expected ErrCacheMiss after delete, got %v", err)
+	}
+}
+
+func TestFileTokenCacheKeysCoexist(t *testing.T) {
+	c := &fileTokenCache{path: filepath.Join(t.TempDir(), "tokens.json")}
+
+	if err := c.Save("key1", Token{AccessToken: "tok-1"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := c.Save("key2", Token{AccessToken: "tok-2"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tok1, err := c.Load("key1")
+	if err != nil || tok1.AccessToken != "tok-1" {
+		t.Fatalf("expected key1 to still hold tok-1, got %+v, err %v", tok1, err)
+	}
+
+	tok2, err := c.Load("key2")
+	if err != nil || tok2.AccessToken != "tok-2" {
+		t.Fatalf("expected key2 to hold tok-2, got %+v, err %v", tok2, err)
+	}
+}
+
+func TestCacheKeyDistinguishesConfigs(t *testing.T) {
+	k1 := cacheKey(&Config{ClientId: "a", BaseApiUrl: "https://x"})
+	k2 := cacheKey(&Config{ClientId: "b", BaseApiUrl: "https://x"})
+	k3 := cacheKey(&Config{ClientId: "a", BaseApiUrl: "https://x", Username: "alice"})
+
+	if k1 == k2 {
+		t.Error("expected different ClientId to produce different cache keys")
+	}
+
+	if k1 == k3 {
+		t.Error("expected different Username to produce different cache keys")
+	}
+
+	if got := cacheKey(&Config{ClientId: "a", BaseApiUrl: "https://x"}); got != k1 {
+		t.Error("expected cacheKey to be deterministic for the same Config fields")
+	}
+}
+
+func TestSessionFromCacheUsesUnexpiredToken(t *testing.T) {
+	cache := &fileTokenCache{path: filepath.Join(t.TempDir(), "tokens.json")}
+	cnf := &Config{ClientId: "clientid", BaseApiUrl: "https://example.invalid", TokenCache: cache}
+
+	if err := cache.Save(cacheKey(cnf), Token{
+		AccessToken: "cached-tok",
+		ExpiresAt:   time.Now().Add(time.Hour),
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	s := &Session{Config: cnf}
+	got, ok := s.fromCache()
+	if !ok {
+		t.Fatal("expected fromCache to hit")
+	}
+
+	if got.AccessToken != "cached-tok" {
+		t.Errorf("expected cached token to be used, got %q", got.AccessToken)
+	}
+}
+
+func TestSessionFromCacheMissesOnExpiredTokenWithoutRefreshToken(t *testing.T) {
+	cache := &fileTokenCache{path: filepath.Join(t.TempDir(), "tokens.json")}
+	cnf := &Config{ClientId: "clientid", BaseApiUrl: "https://example.invalid", TokenCache: cache}
+
+	if err := cache.Save(cacheKey(cnf), Token{
+		AccessToken: "stale-tok",
+		ExpiresAt:   time.Now().Add(-time.Hour),
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	s := &Session{Config: cnf}
+	if _, ok := s.fromCache(); ok {
+		t.Fatal("expected fromCache to miss on an expired token with no refresh token")
+	}
+}